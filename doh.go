@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const dnsMessageContentType = "application/dns-message"
+
+// DoHTransport exchanges queries over DNS-over-HTTPS (RFC 8484)
+// against a configured endpoint such as
+// https://cloudflare-dns.com/dns-query or https://dns.google/dns-query.
+// By default it POSTs the raw wire query; set UseGET to send it as a
+// base64url-encoded query parameter instead.
+type DoHTransport struct {
+	URL    string
+	UseGET bool
+
+	client *http.Client
+}
+
+func NewDoHTransport(url string) *DoHTransport {
+	return &DoHTransport{
+		URL:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (t *DoHTransport) Exchange(query []byte) ([]byte, error) {
+	if t.UseGET {
+		return t.exchangeGET(query)
+	}
+	return t.exchangePOST(query)
+}
+
+func (t *DoHTransport) exchangePOST(query []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, t.URL, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dnsMessageContentType)
+	req.Header.Set("Accept", dnsMessageContentType)
+
+	return t.do(req)
+}
+
+func (t *DoHTransport) exchangeGET(query []byte) ([]byte, error) {
+	encoded := base64.RawURLEncoding.EncodeToString(query)
+
+	req, err := http.NewRequest(http.MethodGet, t.URL+"?dns="+encoded, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", dnsMessageContentType)
+
+	return t.do(req)
+}
+
+func (t *DoHTransport) do(req *http.Request) ([]byte, error) {
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("doh: server returned status %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+)
+
+// dotPort is the standard port for DNS-over-TLS (RFC 7858).
+const dotPort = "853"
+
+// DoTTransport exchanges queries over DNS-over-TLS: the same
+// length-prefixed framing as plain TCP, but wrapped in a crypto/tls
+// connection with SNI and certificate verification, reusing
+// connections out of a pool just like TCPTransport.
+type DoTTransport struct {
+	pool *connPool
+}
+
+// NewDoTTransport dials server (host, or host:port if a non-default
+// port is needed) over TLS on the DNS-over-TLS port.
+func NewDoTTransport(server string) *DoTTransport {
+	host := server
+	if h, _, err := net.SplitHostPort(server); err == nil {
+		host = h
+	}
+	addr := net.JoinHostPort(host, dotPort)
+
+	return &DoTTransport{
+		pool: newConnPool(func() (net.Conn, error) {
+			return tls.Dial("tcp", addr, &tls.Config{ServerName: host})
+		}),
+	}
+}
+
+func (t *DoTTransport) Exchange(query []byte) ([]byte, error) {
+	conn, err := t.pool.get()
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := exchangeFramed(conn, query)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	t.pool.put(conn)
+	return response, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import "bytes"
+
+// edns0DOFlag is the DNSSEC OK bit within the OPT record's flags field
+// (the low 16 bits of the repurposed TTL field).
+const edns0DOFlag = uint32(1 << 15)
+
+// queryOptions accumulates the settings a QueryOption can configure on
+// an EDNS(0) OPT pseudo-record.
+type queryOptions struct {
+	udpPayloadSize uint16
+	dnssecOK       bool
+}
+
+// QueryOption configures the EDNS(0) OPT record added to a query by
+// buildQuery/buildQueryWithFlags. With no options, no OPT record is
+// added and the query behaves exactly as it did before EDNS(0) support.
+type QueryOption func(*queryOptions)
+
+// WithUDPSize advertises the given UDP payload size to the server via
+// the OPT record's CLASS field.
+func WithUDPSize(size uint16) QueryOption {
+	return func(o *queryOptions) {
+		o.udpPayloadSize = size
+	}
+}
+
+// WithDNSSECOK sets the DO (DNSSEC OK) bit, requesting that the server
+// include DNSSEC RRSIG/DNSKEY records in its response.
+func WithDNSSECOK() QueryOption {
+	return func(o *queryOptions) {
+		o.dnssecOK = true
+	}
+}
+
+// buildOPTRecord encodes an EDNS(0) OPT pseudo-record for the
+// Additionals section: NAME is the root, TYPE is 41, CLASS carries the
+// requested UDP payload size, and TTL packs the extended RCODE,
+// version and flags (only the DO bit, for now). We don't yet emit any
+// TLV options (ECS/COOKIE/NSID), so RDLENGTH is always 0.
+func buildOPTRecord(opts []QueryOption) []byte {
+	o := &queryOptions{udpPayloadSize: udpReadBufferSize}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	buf := new(bytes.Buffer)
+
+	buf.WriteByte(0) // NAME: root
+	writeBinary(buf, TypeOPT, "optType")
+	writeBinary(buf, o.udpPayloadSize, "optUDPPayloadSize")
+
+	var ttl uint32
+	if o.dnssecOK {
+		ttl |= edns0DOFlag
+	}
+	writeBinary(buf, ttl, "optTTL")
+
+	writeBinary(buf, uint16(0), "optRDLength")
+
+	return buf.Bytes()
+}
+
+// OPTData is the decoded form of an OPT pseudo-record: the extended
+// RCODE/version/DO flag packed into what would otherwise be the TTL,
+// plus whatever TLV options the record carried.
+type OPTData struct {
+	UDPPayloadSize uint16
+	ExtendedRCODE  uint8
+	Version        uint8
+	DNSSECOK       bool
+	Options        []EDNSOption
+}
+
+// EDNSOption is a single TLV entry from an OPT record's RDATA, e.g. an
+// ECS, COOKIE or NSID option.
+type EDNSOption struct {
+	Code uint16
+	Data []byte
+}
+
+// parseOPTData decodes an OPT record's pseudo-fields and its RDATA
+// option list. record.Class and record.Ttl have already been read
+// generically by parseRecord; here they're reinterpreted per RFC 6891
+// rather than treated as an ordinary class/TTL.
+func (d *DNSResponseParser) parseOPTData(record *DNSRecord) (OPTData, error) {
+	opt := OPTData{
+		UDPPayloadSize: record.Class,
+		ExtendedRCODE:  uint8(record.Ttl >> 24),
+		Version:        uint8(record.Ttl >> 16),
+		DNSSECOK:       record.Ttl&edns0DOFlag != 0,
+	}
+
+	remaining := int(record.DataLength)
+	for remaining > 0 {
+		var code, length uint16
+		if err := d.readUint16(&code); err != nil {
+			return OPTData{}, errParsingRecord
+		}
+		if err := d.readUint16(&length); err != nil {
+			return OPTData{}, errParsingRecord
+		}
+		remaining -= 4
+
+		data := make([]byte, length)
+		if _, err := d.read(data); err != nil {
+			return OPTData{}, errParsingRecord
+		}
+		remaining -= int(length)
+
+		opt.Options = append(opt.Options, EDNSOption{Code: code, Data: data})
+	}
+
+	return opt, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import "testing"
+
+// buildRawOPTRecord hand-assembles an OPT pseudo-record's wire bytes,
+// including TLV options that buildOPTRecord doesn't yet know how to
+// emit, so tests can exercise parseOPTData's option-list decoding the
+// way the query builder would if it ever grew that ability.
+func buildRawOPTRecord(udpPayloadSize uint16, dnssecOK bool, options []EDNSOption) []byte {
+	var rdata []byte
+	for _, opt := range options {
+		rdata = append(rdata, byte(opt.Code>>8), byte(opt.Code))
+		rdata = append(rdata, byte(len(opt.Data)>>8), byte(len(opt.Data)))
+		rdata = append(rdata, opt.Data...)
+	}
+
+	var ttl uint32
+	if dnssecOK {
+		ttl |= edns0DOFlag
+	}
+
+	buf := []byte{0} // NAME: root
+	buf = append(buf, byte(TypeOPT>>8), byte(TypeOPT))
+	buf = append(buf, byte(udpPayloadSize>>8), byte(udpPayloadSize))
+	buf = append(buf, byte(ttl>>24), byte(ttl>>16), byte(ttl>>8), byte(ttl))
+	buf = append(buf, byte(len(rdata)>>8), byte(len(rdata)))
+	buf = append(buf, rdata...)
+
+	return buf
+}
+
+// withAdditional appends an Additional record's bytes to query and
+// bumps the header's NumAdditionals count (bytes 10-11) to match.
+func withAdditional(query []byte, record []byte) []byte {
+	numAdditionals := uint16(query[10])<<8 | uint16(query[11])
+	numAdditionals++
+	query[10] = byte(numAdditionals >> 8)
+	query[11] = byte(numAdditionals)
+
+	return append(query, record...)
+}
+
+// TestEDNSOptionsRoundTrip checks that WithUDPSize/WithDNSSECOK survive
+// a build/parse round trip through buildQuery and parseMessage.
+func TestEDNSOptionsRoundTrip(t *testing.T) {
+	query := buildQuery("example.com", TypeA, WithUDPSize(4096), WithDNSSECOK())
+
+	msg, err := NewParser(query).parseMessage()
+	if err != nil {
+		t.Fatal("failed to parse built query:", err)
+	}
+
+	if len(msg.Additionals) != 1 {
+		t.Fatalf("expected 1 additional record, got %d", len(msg.Additionals))
+	}
+
+	opt, ok := msg.Additionals[0].Data.(OPTData)
+	if !ok {
+		t.Fatalf("expected additional record to decode as OPTData, got %T", msg.Additionals[0].Data)
+	}
+
+	if opt.UDPPayloadSize != 4096 {
+		t.Fatalf("expected UDP payload size 4096, got %d", opt.UDPPayloadSize)
+	}
+	if !opt.DNSSECOK {
+		t.Fatal("expected DNSSEC OK bit to be set")
+	}
+	if len(opt.Options) != 0 {
+		t.Fatalf("expected no TLV options, got %d", len(opt.Options))
+	}
+}
+
+// TestEDNSOptionsRoundTripWithTLVOption checks that an OPT record
+// carrying a TLV option (e.g. NSID) decodes back to the same code and
+// data it was built with.
+func TestEDNSOptionsRoundTripWithTLVOption(t *testing.T) {
+	query := withAdditional(
+		buildQueryWithFlags("example.com", TypeA, 0),
+		buildRawOPTRecord(4096, false, []EDNSOption{{Code: 3, Data: []byte("abc")}}),
+	)
+
+	msg, err := NewParser(query).parseMessage()
+	if err != nil {
+		t.Fatal("failed to parse built query:", err)
+	}
+
+	if len(msg.Additionals) != 1 {
+		t.Fatalf("expected 1 additional record, got %d", len(msg.Additionals))
+	}
+
+	opt, ok := msg.Additionals[0].Data.(OPTData)
+	if !ok {
+		t.Fatalf("expected additional record to decode as OPTData, got %T", msg.Additionals[0].Data)
+	}
+
+	if len(opt.Options) != 1 {
+		t.Fatalf("expected 1 TLV option, got %d", len(opt.Options))
+	}
+	if opt.Options[0].Code != 3 || string(opt.Options[0].Data) != "abc" {
+		t.Fatalf("TLV option didn't round-trip: got %+v", opt.Options[0])
+	}
+}
+
+// TestParseOPTDataRejectsMalformedLength checks that an OPT record
+// whose TLV option declares a length reaching past its own RDATA fails
+// to parse instead of reading into whatever comes after it in the
+// message.
+func TestParseOPTDataRejectsMalformedLength(t *testing.T) {
+	optRecord := buildRawOPTRecord(4096, false, []EDNSOption{{Code: 3, Data: []byte("abc")}})
+
+	// Shrink the option's declared length, in the RDATA itself, so it
+	// claims to hold more data than the record actually carries.
+	rdlengthOffset := 9
+	optionLengthOffset := rdlengthOffset + 2 + 2 // past RDLENGTH, CODE
+	optRecord[optionLengthOffset] = 0
+	optRecord[optionLengthOffset+1] = 200
+
+	query := withAdditional(buildQueryWithFlags("example.com", TypeA, 0), optRecord)
+
+	if _, err := NewParser(query).parseMessage(); err == nil {
+		t.Fatal("expected an error for a malformed OPT option length, got nil")
+	}
+}
@@ -7,16 +7,24 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
-	"net"
 	"strings"
 )
 
 const (
-	typeARecord = uint16(1)
-	classIN     = uint16(1)
+	classIN = uint16(1)
 
 	lenRecordType = int(2)
 	lenClass      = int(2)
+
+	// maxLabelLength is the largest value a non-pointer label's length
+	// byte can hold (RFC 1035 section 3.1).
+	maxLabelLength = 63
+
+	// maxNamePointerHops bounds how many compression pointers we'll
+	// follow while resolving a single domain name, so a packet that
+	// tries to chain pointers into a loop or a long chase gets rejected
+	// instead of spinning or exhausting the stack.
+	maxNamePointerHops = 127
 )
 
 var (
@@ -41,7 +49,11 @@ type DNSRecord struct {
 	Class      uint16
 	Ttl        uint32
 	DataLength uint16
-	Data       []byte
+	// Data holds the RDATA decoded according to RecordType: net.IP for
+	// TypeA/TypeAAAA, string for TypeNS/TypeCNAME/TypePTR, MXData for
+	// TypeMX, []string for TypeTXT, SOAData for TypeSOA, or the raw
+	// bytes for any type we don't know how to decode.
+	Data interface{}
 }
 
 type DNSQuestion struct {
@@ -50,20 +62,40 @@ type DNSQuestion struct {
 	recordClass uint16
 }
 
-func buildQuery(domainName string, recordType uint16) []byte {
+// DNSMessage is a fully parsed DNS message: the header plus all four
+// sections, each read according to the counts carried in the header.
+type DNSMessage struct {
+	Header      *DNSHeader
+	Questions   []*DNSQuestion
+	Answers     []*DNSRecord
+	Authorities []*DNSRecord
+	Additionals []*DNSRecord
+}
+
+func buildQuery(domainName string, recordType uint16, opts ...QueryOption) []byte {
+	recursionDesiredFlag := uint16(1 << 8)
+	return buildQueryWithFlags(domainName, recordType, recursionDesiredFlag, opts...)
+}
+
+func buildQueryWithFlags(domainName string, recordType uint16, flags uint16, opts ...QueryOption) []byte {
 	queryId := rand.Intn(1 << 16)
-	recursionDesiredFlag := 1 << 8
 
 	header := DNSHeader{
 		QueryID:      uint16(queryId),
-		Flags:        uint16(recursionDesiredFlag),
+		Flags:        flags,
 		NumQuestions: 1,
 	}
 
 	name := encodeDomain(domainName)
 
+	var optRecord []byte
+	if len(opts) > 0 {
+		optRecord = buildOPTRecord(opts)
+		header.NumAdditionals++
+	}
+
 	questionLength := len(name) + lenRecordType + lenClass
-	querySize := binary.Size(header) + questionLength
+	querySize := binary.Size(header) + questionLength + len(optRecord)
 	queryBuf := bytes.NewBuffer(make([]byte, 0, querySize))
 
 	// Encode header
@@ -74,6 +106,9 @@ func buildQuery(domainName string, recordType uint16) []byte {
 	writeBinary(queryBuf, recordType, "recordType")
 	writeBinary(queryBuf, classIN, "class")
 
+	// Encode the EDNS(0) OPT pseudo-record, if requested
+	writeBinary(queryBuf, optRecord, "optRecord")
+
 	return queryBuf.Bytes()
 }
 
@@ -149,66 +184,112 @@ func (d *DNSResponseParser) parseQuestion() (*DNSQuestion, error) {
 }
 
 func (d *DNSResponseParser) parseDomainName() ([]byte, error) {
+	return d.parseDomainNameFollowing(0)
+}
+
+// parseDomainNameFollowing parses a domain name starting at d.offset,
+// following at most one compression pointer per call and recursing for
+// the rest of the name. hops counts indirections already followed for
+// this name and is capped at maxNamePointerHops so a packet can't send
+// us chasing pointers forever.
+func (d *DNSResponseParser) parseDomainNameFollowing(hops int) ([]byte, error) {
 	nameParts := make([][]byte, 0)
 
 	for {
-		lenByte := make([]byte, 1)
-		n := copy(lenByte, d.bytes[d.offset:d.offset+1])
-		if n < len(lenByte) {
+		lenByte, err := d.byteAt(d.offset)
+		if err != nil {
 			return nil, errParsingDomainName
 		}
-		d.offset += n
 
-		if lenByte[0]&0b11000000 == 0b11000000 {
-			pointer := d.bytes[d.offset]
+		switch lenByte & 0b11000000 {
+		case 0b11000000:
+			pointerOffset, err := d.compressionPointerTarget(hops)
+			if err != nil {
+				return nil, err
+			}
 
-			name, err := d.parseCompressedName(pointer)
+			// The pointer consumes its own two bytes; restore that once
+			// the pointed-to name has been resolved.
+			afterPointer := d.offset + 2
+			d.offset = pointerOffset
+
+			name, err := d.parseDomainNameFollowing(hops + 1)
 			if err != nil {
 				return nil, err
 			}
 
+			d.offset = afterPointer
 			nameParts = append(nameParts, name)
-			d.offset += 1
-			break
+
+			return bytes.Join(nameParts, []byte(".")), nil
+
+		case 0b01000000, 0b10000000:
+			// Reserved label types (RFC 1035 section 4.1.4) - neither a
+			// length-prefixed label nor a compression pointer.
+			return nil, errParsingDomainName
 		}
 
-		partLength := int(lenByte[0])
+		partLength := int(lenByte)
+		d.offset++
+
 		if partLength == 0 {
 			break
 		}
+		if partLength > maxLabelLength {
+			return nil, errParsingDomainName
+		}
 
-		namePart := make([]byte, partLength)
-		n = copy(namePart, d.bytes[d.offset:d.offset+len(namePart)])
-		if n < len(namePart) {
+		namePart, err := d.sliceAt(d.offset, partLength)
+		if err != nil {
 			return nil, errParsingDomainName
 		}
-		d.offset += n
+		d.offset += partLength
 
 		nameParts = append(nameParts, namePart)
 	}
 
-	name := bytes.Join(nameParts, []byte("."))
-
-	return name, nil
+	return bytes.Join(nameParts, []byte(".")), nil
 }
 
-func (d *DNSResponseParser) parseCompressedName(pointer byte) ([]byte, error) {
-	// save current offset
-	currOffset := d.offset
-
-	// set offset to pointer byte
-	d.offset = int(pointer)
+// compressionPointerTarget reads the two pointer bytes at d.offset and
+// returns the 14-bit offset they encode, rejecting anything that would
+// let a crafted packet loop or read out of bounds: the target must lie
+// within the message and strictly before the pointer itself, and we
+// must not already be at the indirection limit.
+func (d *DNSResponseParser) compressionPointerTarget(hops int) (int, error) {
+	if hops >= maxNamePointerHops {
+		return 0, errParsingDomainName
+	}
 
-	// parse domain name
-	name, err := d.parseDomainName()
+	pointerBytes, err := d.sliceAt(d.offset, 2)
 	if err != nil {
-		return nil, err
+		return 0, errParsingDomainName
 	}
 
-	// restore offset
-	d.offset = currOffset
+	target := int(pointerBytes[0]&0x3F)<<8 | int(pointerBytes[1])
+	if target < 0 || target >= len(d.bytes) || target >= d.offset {
+		return 0, errParsingDomainName
+	}
+
+	return target, nil
+}
 
-	return name, nil
+// byteAt and sliceAt read from the message without ever slicing past
+// its bounds, so a truncated or malicious offset returns an error
+// instead of panicking.
+func (d *DNSResponseParser) byteAt(offset int) (byte, error) {
+	b, err := d.sliceAt(offset, 1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *DNSResponseParser) sliceAt(offset, length int) ([]byte, error) {
+	if offset < 0 || length < 0 || offset+length > len(d.bytes) {
+		return nil, errParsingDomainName
+	}
+	return d.bytes[offset : offset+length], nil
 }
 
 func (d *DNSResponseParser) parseRecord() (*DNSRecord, error) {
@@ -241,16 +322,80 @@ func (d *DNSResponseParser) parseRecord() (*DNSRecord, error) {
 		return nil, err
 	}
 
-	// Read data
-	record.Data = make([]byte, record.DataLength)
-	_, err = d.read(record.Data)
+	// Read and decode data according to the record type
+	dataStart := d.offset
+	record.Data, err = d.parseRecordData(record)
 	if err != nil {
+		return nil, err
+	}
+
+	// A decoder that follows a compression pointer (NS/CNAME/PTR/MX/SOA)
+	// can return successfully having consumed far fewer bytes than
+	// DataLength promised, leaving the cursor short of where this record
+	// said it would end - and every record after it parsed from the
+	// wrong offset. Catch that here rather than trusting RDLENGTH.
+	if d.offset-dataStart != int(record.DataLength) {
 		return nil, errParsingRecord
 	}
 
 	return record, nil
 }
 
+// parseMessage reads the header followed by all of the questions,
+// answers, authorities and additionals it declares, rather than leaving
+// callers to pull records out one at a time.
+func (d *DNSResponseParser) parseMessage() (*DNSMessage, error) {
+	header, err := d.parseHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	questions := make([]*DNSQuestion, 0, header.NumQuestions)
+	for i := 0; i < int(header.NumQuestions); i++ {
+		question, err := d.parseQuestion()
+		if err != nil {
+			return nil, err
+		}
+		questions = append(questions, question)
+	}
+
+	answers, err := d.parseRecords(int(header.NumAnswers))
+	if err != nil {
+		return nil, err
+	}
+
+	authorities, err := d.parseRecords(int(header.NumAuthorities))
+	if err != nil {
+		return nil, err
+	}
+
+	additionals, err := d.parseRecords(int(header.NumAdditionals))
+	if err != nil {
+		return nil, err
+	}
+
+	return &DNSMessage{
+		Header:      header,
+		Questions:   questions,
+		Answers:     answers,
+		Authorities: authorities,
+		Additionals: additionals,
+	}, nil
+}
+
+func (d *DNSResponseParser) parseRecords(count int) ([]*DNSRecord, error) {
+	records := make([]*DNSRecord, 0, count)
+	for i := 0; i < count; i++ {
+		record, err := d.parseRecord()
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
 func (d *DNSResponseParser) readUint16(val *uint16) error {
 	buf := make([]byte, 2)
 
@@ -288,55 +433,14 @@ func (d *DNSResponseParser) read(buf []byte) (int, error) {
 }
 
 func main() {
-	query := buildQuery("www.google.com", typeARecord)
-
-	// resolve the address for 8.8.8.8 and port 53
-	udpAddr, err := net.ResolveUDPAddr("udp", "8.8.8.8:53")
-	if err != nil {
-		log.Fatal("Failed to resolve UDP address:", err)
-		return
-	}
-
-	// create a UDP socket
-	conn, err := net.DialUDP("udp", nil, udpAddr)
-	if err != nil {
-		log.Fatal("Failed to create UDP socket:", err)
-		return
-	}
-	defer conn.Close()
-
-	// send our query
-	_, err = conn.Write(query)
-	if err != nil {
-		log.Fatal("Failed to send query:", err)
-		return
-	}
+	resolver := NewResolver()
 
-	buffer := make([]byte, 1024)
-	n, _, err := conn.ReadFromUDP(buffer)
+	records, err := resolver.Resolve("www.google.com", TypeA)
 	if err != nil {
-		log.Fatal("Failed to read response:", err)
-		return
+		log.Fatal("Failed to resolve name:", err)
 	}
 
-	response := buffer[:n]
-
-	parser := NewParser(response)
-
-	_, err = parser.parseHeader()
-	if err != nil {
-		log.Fatal("Failed to parse response header:", err)
-	}
-
-	_, err = parser.parseQuestion()
-	if err != nil {
-		log.Fatal("Failed to parse question:", err)
+	for _, record := range records {
+		fmt.Printf("IP address %s\n", record.Data)
 	}
-
-	record, err := parser.parseRecord()
-	if err != nil {
-		log.Fatal("Failed to parse DNS record:", err)
-	}
-
-	fmt.Printf("IP address %d", record.Data)
 }
@@ -30,7 +30,7 @@ func TestBuildQuery(t *testing.T) {
 	}
 
 	host := "www.example.com"
-	query := buildQuery(host, typeARecord)
+	query := buildQuery(host, TypeA)
 
 	offsetAfterRandomId := 4
 
@@ -58,3 +58,30 @@ func TestParseHeader(t *testing.T) {
 		t.Fatalf("expected %d but got %d", 0x1, header.NumQuestions)
 	}
 }
+
+// FuzzParseDomainName feeds arbitrary byte strings into domain name
+// parsing, where compression pointers make it easiest to construct a
+// malicious offset or a pointer loop.
+func FuzzParseDomainName(f *testing.F) {
+	f.Add([]byte{0})
+	f.Add([]byte{3, 'w', 'w', 'w', 0})
+	f.Add([]byte{0xc0, 0x00})
+	f.Add([]byte{0xc0, 0xff})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p := NewParser(data)
+		_, _ = p.parseDomainName()
+	})
+}
+
+// FuzzParseMessage exercises the full header/question/record loop
+// against arbitrary input, since header counts are also attacker
+// controlled and could otherwise drive the parser past the buffer.
+func FuzzParseMessage(f *testing.F) {
+	f.Add([]byte{134, 253, 129, 128, 0, 1, 0, 1, 0, 0, 0, 0, 3, 119, 119, 119, 7, 101, 120, 97, 109, 112, 108, 101, 3, 99, 111, 109, 0, 0, 1, 0, 1, 192, 12, 0, 1, 0, 1, 0, 0, 80, 205, 0, 4, 93, 184, 216, 34})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p := NewParser(data)
+		_, _ = p.parseMessage()
+	})
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Resource record types we know how to decode. Names and numbers follow
+// RFC 1035 (and RFC 3596 for AAAA).
+const (
+	TypeA     = uint16(1)
+	TypeNS    = uint16(2)
+	TypeCNAME = uint16(5)
+	TypeSOA   = uint16(6)
+	TypePTR   = uint16(12)
+	TypeMX    = uint16(15)
+	TypeTXT   = uint16(16)
+	TypeAAAA  = uint16(28)
+	TypeOPT   = uint16(41)
+)
+
+// MXData is the decoded RDATA of an MX record.
+type MXData struct {
+	Preference uint16
+	Exchange   string
+}
+
+// SOAData is the decoded RDATA of an SOA record.
+type SOAData struct {
+	MName   string
+	RName   string
+	Serial  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	Minimum uint32
+}
+
+// parseRecordData reads record.DataLength bytes of RDATA and decodes it
+// according to record.RecordType. Domain names embedded in RDATA (NS,
+// CNAME, PTR, MX, SOA) are parsed with parseDomainName directly off the
+// wire so that compression pointers into the rest of the message still
+// resolve correctly.
+func (d *DNSResponseParser) parseRecordData(record *DNSRecord) (interface{}, error) {
+	dataLength := int(record.DataLength)
+
+	switch record.RecordType {
+	case TypeA, TypeAAAA:
+		return d.parseAddressData(record.RecordType, dataLength)
+	case TypeNS, TypeCNAME, TypePTR:
+		name, err := d.parseDomainName()
+		if err != nil {
+			return nil, errParsingRecord
+		}
+		return string(name), nil
+	case TypeMX:
+		return d.parseMXData()
+	case TypeTXT:
+		return d.parseTXTData(dataLength)
+	case TypeSOA:
+		return d.parseSOAData()
+	case TypeOPT:
+		return d.parseOPTData(record)
+	default:
+		raw := make([]byte, dataLength)
+		if _, err := d.read(raw); err != nil {
+			return nil, errParsingRecord
+		}
+		return raw, nil
+	}
+}
+
+// parseAddressData reads dataLength bytes as an A or AAAA address,
+// rejecting anything that isn't exactly the 4 or 16 bytes that record
+// type requires - otherwise a mislabeled DataLength would silently
+// produce a valid-looking address of the wrong kind, or a nil-ish one.
+func (d *DNSResponseParser) parseAddressData(recordType uint16, dataLength int) (net.IP, error) {
+	expected := 4
+	if recordType == TypeAAAA {
+		expected = 16
+	}
+	if dataLength != expected {
+		return nil, errParsingRecord
+	}
+
+	buf := make([]byte, dataLength)
+	if _, err := d.read(buf); err != nil {
+		return nil, errParsingRecord
+	}
+
+	return net.IP(buf), nil
+}
+
+func (d *DNSResponseParser) parseMXData() (MXData, error) {
+	var preference uint16
+	if err := d.readUint16(&preference); err != nil {
+		return MXData{}, errParsingRecord
+	}
+
+	exchange, err := d.parseDomainName()
+	if err != nil {
+		return MXData{}, errParsingRecord
+	}
+
+	return MXData{Preference: preference, Exchange: string(exchange)}, nil
+}
+
+// parseTXTData reads the sequence of length-prefixed character-strings
+// that make up TXT RDATA, consuming exactly dataLength bytes.
+func (d *DNSResponseParser) parseTXTData(dataLength int) ([]string, error) {
+	var segments []string
+
+	remaining := dataLength
+	for remaining > 0 {
+		lenByte := make([]byte, 1)
+		if _, err := d.read(lenByte); err != nil {
+			return nil, errParsingRecord
+		}
+		remaining--
+
+		segment := make([]byte, lenByte[0])
+		if _, err := d.read(segment); err != nil {
+			return nil, errParsingRecord
+		}
+		remaining -= len(segment)
+
+		segments = append(segments, string(segment))
+	}
+
+	return segments, nil
+}
+
+func (d *DNSResponseParser) parseSOAData() (SOAData, error) {
+	mname, err := d.parseDomainName()
+	if err != nil {
+		return SOAData{}, errParsingRecord
+	}
+
+	rname, err := d.parseDomainName()
+	if err != nil {
+		return SOAData{}, errParsingRecord
+	}
+
+	soa := SOAData{MName: string(mname), RName: string(rname)}
+
+	for _, field := range []*uint32{&soa.Serial, &soa.Refresh, &soa.Retry, &soa.Expire, &soa.Minimum} {
+		if err := d.readUint32(field); err != nil {
+			return SOAData{}, errParsingRecord
+		}
+	}
+
+	return soa, nil
+}
+
+// String renders the record the way dig prints an answer line: name,
+// TTL, class, type and the type-appropriate RDATA.
+func (r *DNSRecord) String() string {
+	return fmt.Sprintf("%s\t%d\t%s\t%s\t%s", r.Name, r.Ttl, classString(r.Class), typeString(r.RecordType), dataString(r.Data))
+}
+
+func typeString(recordType uint16) string {
+	switch recordType {
+	case TypeA:
+		return "A"
+	case TypeAAAA:
+		return "AAAA"
+	case TypeNS:
+		return "NS"
+	case TypeCNAME:
+		return "CNAME"
+	case TypeMX:
+		return "MX"
+	case TypeTXT:
+		return "TXT"
+	case TypeSOA:
+		return "SOA"
+	case TypePTR:
+		return "PTR"
+	case TypeOPT:
+		return "OPT"
+	default:
+		return fmt.Sprintf("TYPE%d", recordType)
+	}
+}
+
+func classString(class uint16) string {
+	if class == classIN {
+		return "IN"
+	}
+	return fmt.Sprintf("CLASS%d", class)
+}
+
+func dataString(data interface{}) string {
+	switch v := data.(type) {
+	case net.IP:
+		return v.String()
+	case string:
+		return v
+	case []string:
+		quoted := make([]string, len(v))
+		for i, s := range v {
+			quoted[i] = fmt.Sprintf("%q", s)
+		}
+		return strings.Join(quoted, " ")
+	case MXData:
+		return fmt.Sprintf("%d %s", v.Preference, v.Exchange)
+	case SOAData:
+		return fmt.Sprintf("%s %s %d %d %d %d %d", v.MName, v.RName, v.Serial, v.Refresh, v.Retry, v.Expire, v.Minimum)
+	case OPTData:
+		return fmt.Sprintf("udp=%d version=%d do=%t options=%d", v.UDPPayloadSize, v.Version, v.DNSSECOK, len(v.Options))
+	case []byte:
+		return fmt.Sprintf("%x", v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+// buildRecordBytes assembles the wire bytes for a single resource
+// record with a root name, so tests can feed parseRecord/parseMessage
+// malformed RDATA without going through buildResponse.
+func buildRecordBytes(recordType, class uint16, ttl uint32, rdata []byte) []byte {
+	buf := []byte{0} // NAME: root
+	buf = append(buf, byte(recordType>>8), byte(recordType))
+	buf = append(buf, byte(class>>8), byte(class))
+	buf = append(buf, byte(ttl>>24), byte(ttl>>16), byte(ttl>>8), byte(ttl))
+	buf = append(buf, byte(len(rdata)>>8), byte(len(rdata)))
+	buf = append(buf, rdata...)
+	return buf
+}
+
+func TestParseAddressDataRejectsWrongLength(t *testing.T) {
+	tests := []struct {
+		name       string
+		recordType uint16
+		rdata      []byte
+	}{
+		{"A with AAAA-sized RDATA", TypeA, make([]byte, 16)},
+		{"A with empty RDATA", TypeA, nil},
+		{"AAAA with A-sized RDATA", TypeAAAA, make([]byte, 4)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewParser(buildRecordBytes(tt.recordType, classIN, 300, tt.rdata))
+
+			if _, err := d.parseRecord(); err == nil {
+				t.Fatalf("expected an error for %s, got nil", tt.name)
+			}
+		})
+	}
+}
+
+func TestParseAddressDataAcceptsCorrectLength(t *testing.T) {
+	d := NewParser(buildRecordBytes(TypeA, classIN, 300, []byte{93, 184, 216, 34}))
+
+	record, err := d.parseRecord()
+	if err != nil {
+		t.Fatal("parseRecord failed:", err)
+	}
+
+	if got := record.Data.(net.IP).String(); got != "93.184.216.34" {
+		t.Fatalf("unexpected address: %q", got)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+const (
+	// maxReferrals bounds how many NS referrals we'll follow before giving
+	// up, so a misbehaving or malicious zone can't send us in circles.
+	maxReferrals = 16
+
+	dnsPort = "53"
+)
+
+// rootHints is a small bundled seed list of root servers to start an
+// iterative walk from. A real resolver would ship all thirteen; a handful
+// is enough to bootstrap a lookup.
+var rootHints = []string{
+	"198.41.0.4",   // a.root-servers.net
+	"199.9.14.201", // b.root-servers.net
+	"192.33.4.12",  // c.root-servers.net
+	"192.5.5.241",  // f.root-servers.net
+}
+
+var errMaxReferralsExceeded = fmt.Errorf("exceeded maximum number of referrals (%d) while resolving", maxReferrals)
+
+// Resolver resolves names either by walking the DNS hierarchy itself
+// starting from the root zone, or - if constructed with a Transport -
+// by sending a stub query to that single upstream (a DoT or DoH
+// endpoint, say) and letting it do the recursion.
+type Resolver struct {
+	// nsCache maps a zone name (e.g. "com.") to the set of nameserver IPs
+	// known to be authoritative for it, so repeated lookups under the
+	// same zone skip re-walking from the root.
+	nsCache map[string][]string
+
+	// transport, when set, turns Resolve into a stub resolver that asks
+	// this single upstream to do the recursive work, instead of walking
+	// referrals from the root hints itself.
+	transport Transport
+
+	// dial returns the Transport to use to query a given server during
+	// iterative resolution. It defaults to plain UDP (with its own TCP
+	// fallback); tests override it to query fakes instead of the network.
+	dial func(server string) Transport
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{
+		nsCache: make(map[string][]string),
+		dial:    func(server string) Transport { return NewUDPTransport(server) },
+	}
+}
+
+// NewStubResolver returns a Resolver that forwards every query to
+// transport (with RD=1) and trusts it to do the recursion, rather than
+// walking NS referrals itself. This is how toydns does lookups against
+// a fixed upstream like 1.1.1.1 over DoT or a DoH endpoint.
+func NewStubResolver(transport Transport) *Resolver {
+	return &Resolver{
+		nsCache:   make(map[string][]string),
+		transport: transport,
+		dial:      func(server string) Transport { return NewUDPTransport(server) },
+	}
+}
+
+// Resolve walks the DNS hierarchy starting at the root hints, following
+// NS referrals (using glue records when present) until it reaches a
+// server that answers authoritatively, then returns the final records.
+// CNAME answers are followed by re-querying the target name from the
+// root. If the Resolver was built with a Transport, it instead sends a
+// single recursive query to that upstream and follows any CNAME chain
+// through the same transport.
+func (r *Resolver) Resolve(name string, qtype uint16) ([]DNSRecord, error) {
+	if r.transport != nil {
+		return r.resolveStub(name, qtype)
+	}
+
+	currentName := name
+
+	for referral := 0; referral < maxReferrals; referral++ {
+		servers := r.serversForZone(currentName)
+
+		records, cnameTarget, err := r.queryServers(servers, currentName, qtype, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if cnameTarget != "" {
+			currentName = cnameTarget
+			continue
+		}
+
+		if records != nil {
+			return records, nil
+		}
+	}
+
+	return nil, errMaxReferralsExceeded
+}
+
+// resolveStub sends a recursive (RD=1) query to r.transport, following
+// any CNAME chain by re-querying the same transport.
+func (r *Resolver) resolveStub(name string, qtype uint16) ([]DNSRecord, error) {
+	currentName := name
+
+	for referral := 0; referral < maxReferrals; referral++ {
+		response, err := r.transport.Exchange(buildQuery(currentName, qtype))
+		if err != nil {
+			return nil, err
+		}
+
+		msg, err := NewParser(response).parseMessage()
+		if err != nil {
+			return nil, err
+		}
+
+		answers, cnameTarget := directAnswer(msg, currentName, qtype)
+		if cnameTarget != "" {
+			currentName = cnameTarget
+			continue
+		}
+
+		if answers != nil {
+			return answers, nil
+		}
+
+		return nil, fmt.Errorf("no answer received for %s", name)
+	}
+
+	return nil, errMaxReferralsExceeded
+}
+
+// serversForZone returns the best known set of nameserver IPs to start
+// querying for name, preferring the most specific cached zone (the one
+// whose name shares the longest suffix with name) and falling back to
+// the root hints.
+func (r *Resolver) serversForZone(name string) []string {
+	var bestZone string
+	var bestServers []string
+
+	for zone, servers := range r.nsCache {
+		if zone == "." || !(name == zone || isSubdomainOf(name, zone)) {
+			continue
+		}
+
+		if bestServers == nil || len(zone) > len(bestZone) {
+			bestZone = zone
+			bestServers = servers
+		}
+	}
+
+	if bestServers != nil {
+		return bestServers
+	}
+
+	return rootHints
+}
+
+// queryServers walks down the referral chain for a single name: it
+// queries each candidate server, and if the server refers us further
+// down the tree, follows that referral itself. referral counts how many
+// times this chain has already recursed into a further referral, and is
+// bounded by maxReferrals so a zone that keeps referring us elsewhere
+// (accidentally or adversarially) can't recurse forever.
+func (r *Resolver) queryServers(servers []string, name string, qtype uint16, referral int) ([]DNSRecord, string, error) {
+	if referral >= maxReferrals {
+		return nil, "", errMaxReferralsExceeded
+	}
+
+	for _, server := range servers {
+		msg, err := r.exchange(server, name, qtype)
+		if err != nil {
+			continue
+		}
+
+		if answers, cname := directAnswer(msg, name, qtype); answers != nil || cname != "" {
+			return answers, cname, nil
+		}
+
+		zone, nextServers := r.referral(msg)
+		if len(nextServers) == 0 {
+			continue
+		}
+
+		if zone != "" {
+			r.nsCache[zone] = nextServers
+		}
+
+		return r.queryServers(nextServers, name, qtype, referral+1)
+	}
+
+	return nil, "", fmt.Errorf("no server in %v answered for %s", servers, name)
+}
+
+func (r *Resolver) exchange(server string, name string, qtype uint16) (*DNSMessage, error) {
+	query := buildQueryWithFlags(name, qtype, 0)
+
+	response, err := r.dial(server).Exchange(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewParser(response).parseMessage()
+}
+
+// directAnswer returns the answer records for name/qtype if the message
+// contains any, or the target name to re-query if the answer was a
+// CNAME instead.
+func directAnswer(msg *DNSMessage, name string, qtype uint16) ([]DNSRecord, string) {
+	if len(msg.Answers) == 0 {
+		return nil, ""
+	}
+
+	var answers []DNSRecord
+	for _, record := range msg.Answers {
+		if record.RecordType == qtype {
+			answers = append(answers, *record)
+			continue
+		}
+
+		if record.RecordType == TypeCNAME {
+			if target, ok := record.Data.(string); ok {
+				return nil, target
+			}
+		}
+	}
+
+	return answers, ""
+}
+
+// referral extracts the next zone to query and the IPs of its
+// nameservers (from Authority NS records plus Additional glue) out of a
+// non-authoritative response.
+func (r *Resolver) referral(msg *DNSMessage) (string, []string) {
+	if len(msg.Authorities) == 0 {
+		return "", nil
+	}
+
+	zone := ""
+	nsNames := make(map[string]bool)
+	for _, record := range msg.Authorities {
+		if record.RecordType != TypeNS {
+			continue
+		}
+		if nsName, ok := record.Data.(string); ok {
+			zone = string(record.Name)
+			nsNames[nsName] = true
+		}
+	}
+
+	if len(nsNames) == 0 {
+		return "", nil
+	}
+
+	var glueIPs []string
+	for _, record := range msg.Additionals {
+		if record.RecordType != TypeA {
+			continue
+		}
+		if ip, ok := record.Data.(net.IP); ok && nsNames[string(record.Name)] {
+			glueIPs = append(glueIPs, ip.String())
+		}
+	}
+
+	return zone, glueIPs
+}
+
+func isSubdomainOf(name, zone string) bool {
+	suffix := "." + zone
+	return len(name) > len(suffix) && name[len(name)-len(suffix):] == suffix
+}
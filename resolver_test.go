@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"testing"
+)
+
+// fakeTransportFunc lets a test answer queries however it likes -
+// based on the queried name, a canned byte slice, or anything else -
+// without any of Resolver's iterative walk touching the network.
+type fakeTransportFunc func(query []byte) ([]byte, error)
+
+func (f fakeTransportFunc) Exchange(query []byte) ([]byte, error) {
+	return f(query)
+}
+
+// fakeTransportResponse always returns the same wire bytes, for a fake
+// server whose answer doesn't depend on what it's asked.
+func fakeTransportResponse(response []byte) Transport {
+	return fakeTransportFunc(func([]byte) ([]byte, error) {
+		return response, nil
+	})
+}
+
+// fakeTransportByName dispatches on the queried name, for a fake server
+// that's asked more than once in the same test with different names
+// (e.g. across a CNAME re-query).
+func fakeTransportByName(responses map[string][]byte) Transport {
+	return fakeTransportFunc(func(query []byte) ([]byte, error) {
+		msg, err := NewParser(query).parseMessage()
+		if err != nil {
+			return nil, err
+		}
+		name := string(msg.Questions[0].domainName)
+		response, ok := responses[name]
+		if !ok {
+			return nil, fmt.Errorf("no fake response configured for %s", name)
+		}
+		return response, nil
+	})
+}
+
+func mustBuildResponse(t *testing.T, answers, authorities, additionals []DNSRecord) []byte {
+	t.Helper()
+
+	response, err := buildResponse(DNSHeader{Flags: 0x8000}, nil, answers, authorities, additionals)
+	if err != nil {
+		t.Fatal("buildResponse failed:", err)
+	}
+	return response
+}
+
+func nsReferral(t *testing.T, zone, nsName, glueIP string) []byte {
+	return mustBuildResponse(t, nil,
+		[]DNSRecord{{Name: []byte(zone), RecordType: TypeNS, Class: classIN, Ttl: 300, Data: nsName}},
+		[]DNSRecord{{Name: []byte(nsName), RecordType: TypeA, Class: classIN, Ttl: 300, Data: net.ParseIP(glueIP).To4()}},
+	)
+}
+
+func aAnswer(t *testing.T, name, ip string) []byte {
+	return mustBuildResponse(t,
+		[]DNSRecord{{Name: []byte(name), RecordType: TypeA, Class: classIN, Ttl: 300, Data: net.ParseIP(ip).To4()}},
+		nil, nil,
+	)
+}
+
+func cnameAnswer(t *testing.T, name, target string) []byte {
+	return mustBuildResponse(t,
+		[]DNSRecord{{Name: []byte(name), RecordType: TypeCNAME, Class: classIN, Ttl: 300, Data: target}},
+		nil, nil,
+	)
+}
+
+// TestResolveFollowsReferral checks that Resolve walks a referral chain
+// (root hint -> "com" servers -> "example.com" servers) down to a final
+// answer, using the glue IPs carried in each referral.
+func TestResolveFollowsReferral(t *testing.T) {
+	toCom := nsReferral(t, "com", "a.gtld.com", "192.0.2.1")
+	toExampleCom := nsReferral(t, "example.com", "ns1.example.com", "192.0.2.2")
+	answer := aAnswer(t, "www.example.com", "93.184.216.34")
+
+	r := NewResolver()
+	r.dial = func(server string) Transport {
+		switch server {
+		case rootHints[0]:
+			return fakeTransportResponse(toCom)
+		case "192.0.2.1":
+			return fakeTransportResponse(toExampleCom)
+		case "192.0.2.2":
+			return fakeTransportResponse(answer)
+		default:
+			return fakeTransportFunc(func([]byte) ([]byte, error) {
+				return nil, fmt.Errorf("unexpected query to %s", server)
+			})
+		}
+	}
+
+	records, err := r.Resolve("www.example.com", TypeA)
+	if err != nil {
+		t.Fatal("Resolve failed:", err)
+	}
+
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+	if got := records[0].Data.(net.IP).String(); got != "93.184.216.34" {
+		t.Fatalf("unexpected answer: %q", got)
+	}
+
+	if got := r.nsCache["com"]; len(got) != 1 || got[0] != "192.0.2.1" {
+		t.Fatalf("expected the com referral to be cached, got %v", r.nsCache)
+	}
+}
+
+// TestResolveFollowsCNAMEChain checks that a CNAME answer makes Resolve
+// re-query the target name from the top, rather than treating the
+// CNAME itself as a final answer.
+func TestResolveFollowsCNAMEChain(t *testing.T) {
+	responses := map[string][]byte{
+		"alias.example.com": cnameAnswer(t, "alias.example.com", "example.com"),
+		"example.com":       aAnswer(t, "example.com", "93.184.216.34"),
+	}
+
+	r := NewResolver()
+	r.dial = func(server string) Transport {
+		return fakeTransportByName(responses)
+	}
+
+	records, err := r.Resolve("alias.example.com", TypeA)
+	if err != nil {
+		t.Fatal("Resolve failed:", err)
+	}
+
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+	if got := records[0].Data.(net.IP).String(); got != "93.184.216.34" {
+		t.Fatalf("unexpected answer: %q", got)
+	}
+}
+
+// TestResolveRejectsReferralLoop checks that a pair of zones that keep
+// referring to each other doesn't recurse forever - queryServers must
+// give up once maxReferrals is exhausted.
+func TestResolveRejectsReferralLoop(t *testing.T) {
+	toZoneB := nsReferral(t, "b.test", "ns.b.test", "192.0.2.2")
+	toZoneA := nsReferral(t, "a.test", "ns.a.test", "192.0.2.1")
+
+	r := NewResolver()
+	r.dial = func(server string) Transport {
+		switch server {
+		case rootHints[0]:
+			return fakeTransportResponse(toZoneB)
+		case "192.0.2.1":
+			return fakeTransportResponse(toZoneB)
+		case "192.0.2.2":
+			return fakeTransportResponse(toZoneA)
+		default:
+			return fakeTransportFunc(func([]byte) ([]byte, error) {
+				return nil, fmt.Errorf("unexpected query to %s", server)
+			})
+		}
+	}
+
+	_, err := r.Resolve("www.loop.test", TypeA)
+	if err != errMaxReferralsExceeded {
+		t.Fatalf("expected errMaxReferralsExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// buildResponse assembles a complete DNS message from its sections, the
+// mirror image of parseMessage: it fills in the section counts on
+// header, then writes the question(s) and records with the same
+// name-compression scheme a real server would use. It fails if any
+// record holds RDATA of a type this encoder doesn't know how to write.
+func buildResponse(header DNSHeader, questions []DNSQuestion, answers []DNSRecord, authorities []DNSRecord, additionals []DNSRecord) ([]byte, error) {
+	header.NumQuestions = uint16(len(questions))
+	header.NumAnswers = uint16(len(answers))
+	header.NumAuthorities = uint16(len(authorities))
+	header.NumAdditionals = uint16(len(additionals))
+
+	buf := new(bytes.Buffer)
+	writeBinary(buf, &header, "header")
+
+	names := newNameWriter(buf)
+
+	for _, question := range questions {
+		if err := names.writeName(string(question.domainName)); err != nil {
+			return nil, err
+		}
+		writeBinary(buf, question.recordType, "recordType")
+		writeBinary(buf, question.recordClass, "recordClass")
+	}
+
+	for _, section := range [][]DNSRecord{answers, authorities, additionals} {
+		for _, record := range section {
+			if err := writeRecord(buf, names, record); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeRecord(buf *bytes.Buffer, names *nameWriter, record DNSRecord) error {
+	if err := names.writeName(string(record.Name)); err != nil {
+		return err
+	}
+	writeBinary(buf, record.RecordType, "recordType")
+	writeBinary(buf, record.Class, "class")
+	writeBinary(buf, record.Ttl, "ttl")
+
+	// RDLENGTH isn't known until the RDATA - which may itself contain
+	// compressed names - has been written, so reserve two bytes and
+	// patch them in afterwards.
+	lengthOffset := buf.Len()
+	writeBinary(buf, uint16(0), "dataLength")
+
+	dataStart := buf.Len()
+	if err := writeRecordData(buf, names, record); err != nil {
+		return err
+	}
+	dataLength := buf.Len() - dataStart
+
+	binary.BigEndian.PutUint16(buf.Bytes()[lengthOffset:lengthOffset+2], uint16(dataLength))
+
+	return nil
+}
+
+// maxTXTSegmentLength is the largest character-string a TXT segment can
+// hold: its length prefix is a single byte (RFC 1035 section 3.3).
+const maxTXTSegmentLength = 255
+
+func writeRecordData(buf *bytes.Buffer, names *nameWriter, record DNSRecord) error {
+	switch data := record.Data.(type) {
+	case net.IP:
+		if record.RecordType == TypeAAAA {
+			buf.Write(data.To16())
+		} else {
+			buf.Write(data.To4())
+		}
+	case string:
+		return names.writeName(data)
+	case MXData:
+		writeBinary(buf, data.Preference, "preference")
+		return names.writeName(data.Exchange)
+	case []string:
+		for _, segment := range data {
+			if len(segment) > maxTXTSegmentLength {
+				return fmt.Errorf("buildResponse: TXT segment of %d bytes exceeds the %d-byte limit", len(segment), maxTXTSegmentLength)
+			}
+			buf.WriteByte(byte(len(segment)))
+			buf.WriteString(segment)
+		}
+	case SOAData:
+		if err := names.writeName(data.MName); err != nil {
+			return err
+		}
+		if err := names.writeName(data.RName); err != nil {
+			return err
+		}
+		for _, field := range []uint32{data.Serial, data.Refresh, data.Retry, data.Expire, data.Minimum} {
+			writeBinary(buf, field, "soaField")
+		}
+	case []byte:
+		buf.Write(data)
+	default:
+		return fmt.Errorf("buildResponse: don't know how to encode %T RDATA", data)
+	}
+
+	return nil
+}
+
+// nameWriter writes domain names with compression, mirroring the
+// decompression in parseDomainName: it remembers the message offset at
+// which each name (and each of its suffixes) was first written, and
+// emits a 0xC0xx pointer instead of repeating labels already seen.
+type nameWriter struct {
+	buf     *bytes.Buffer
+	offsets map[string]uint16
+}
+
+func newNameWriter(buf *bytes.Buffer) *nameWriter {
+	return &nameWriter{
+		buf:     buf,
+		offsets: make(map[string]uint16),
+	}
+}
+
+func (w *nameWriter) writeName(name string) error {
+	if name == "" {
+		w.buf.WriteByte(0)
+		return nil
+	}
+
+	labels := strings.Split(name, ".")
+
+	for i := range labels {
+		suffix := strings.Join(labels[i:], ".")
+
+		if offset, ok := w.offsets[suffix]; ok {
+			writeBinary(w.buf, uint16(0xC000)|offset, "namePointer")
+			return nil
+		}
+
+		// Pointers only have 14 bits of offset to work with, so don't
+		// bother remembering names past that point in the message.
+		if w.buf.Len() <= 0x3FFF {
+			w.offsets[suffix] = uint16(w.buf.Len())
+		}
+
+		label := labels[i]
+		if len(label) > maxLabelLength {
+			return fmt.Errorf("buildResponse: label %q is %d bytes, over the %d-byte limit", label, len(label), maxLabelLength)
+		}
+
+		w.buf.WriteByte(byte(len(label)))
+		w.buf.WriteString(label)
+	}
+
+	w.buf.WriteByte(0)
+	return nil
+}
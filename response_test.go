@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+// TestBuildResponseRoundTrip builds a response with name compression
+// across several record types and checks that parseMessage reads back
+// exactly what was written - the two are meant to be mirror images of
+// each other, so any drift in nameWriter's pointer bookkeeping or in a
+// writeRecordData case should show up here.
+func TestBuildResponseRoundTrip(t *testing.T) {
+	question := DNSQuestion{
+		domainName:  []byte("www.example.com"),
+		recordType:  TypeA,
+		recordClass: classIN,
+	}
+
+	answers := []DNSRecord{
+		{
+			Name:       []byte("www.example.com"),
+			RecordType: TypeCNAME,
+			Class:      classIN,
+			Ttl:        300,
+			Data:       "example.com",
+		},
+		{
+			Name:       []byte("example.com"),
+			RecordType: TypeA,
+			Class:      classIN,
+			Ttl:        300,
+			Data:       net.ParseIP("93.184.216.34").To4(),
+		},
+		{
+			Name:       []byte("example.com"),
+			RecordType: TypeMX,
+			Class:      classIN,
+			Ttl:        300,
+			Data:       MXData{Preference: 10, Exchange: "mail.example.com"},
+		},
+	}
+
+	response, err := buildResponse(DNSHeader{QueryID: 0xabcd, Flags: 0x8180}, []DNSQuestion{question}, answers, nil, nil)
+	if err != nil {
+		t.Fatal("buildResponse failed:", err)
+	}
+
+	msg, err := NewParser(response).parseMessage()
+	if err != nil {
+		t.Fatal("failed to parse built response:", err)
+	}
+
+	if len(msg.Questions) != 1 || string(msg.Questions[0].domainName) != "www.example.com" {
+		t.Fatalf("question didn't round-trip: %+v", msg.Questions)
+	}
+
+	if len(msg.Answers) != len(answers) {
+		t.Fatalf("expected %d answers, got %d", len(answers), len(msg.Answers))
+	}
+
+	if got := string(msg.Answers[0].Data.(string)); got != "example.com" {
+		t.Fatalf("CNAME target didn't round-trip: got %q", got)
+	}
+
+	if got := msg.Answers[1].Data.(net.IP).String(); got != "93.184.216.34" {
+		t.Fatalf("A record didn't round-trip: got %q", got)
+	}
+
+	mx, ok := msg.Answers[2].Data.(MXData)
+	if !ok || mx.Preference != 10 || mx.Exchange != "mail.example.com" {
+		t.Fatalf("MX record didn't round-trip: got %+v", msg.Answers[2].Data)
+	}
+}
+
+// TestBuildResponseUnknownRDATA checks that an RDATA type the encoder
+// doesn't know how to write returns an error instead of aborting the
+// process.
+func TestBuildResponseUnknownRDATA(t *testing.T) {
+	answers := []DNSRecord{
+		{
+			Name:       []byte("example.com"),
+			RecordType: TypeA,
+			Class:      classIN,
+			Ttl:        300,
+			Data:       42, // not a type writeRecordData knows how to encode
+		},
+	}
+
+	if _, err := buildResponse(DNSHeader{}, nil, answers, nil, nil); err == nil {
+		t.Fatal("expected an error for unencodable RDATA, got nil")
+	}
+}
+
+// TestBuildResponseRejectsOverlongLabel checks that a name with a label
+// over maxLabelLength bytes fails to encode instead of silently
+// truncating the length prefix.
+func TestBuildResponseRejectsOverlongLabel(t *testing.T) {
+	answers := []DNSRecord{
+		{
+			Name:       []byte(strings.Repeat("a", maxLabelLength+1) + ".example.com"),
+			RecordType: TypeA,
+			Class:      classIN,
+			Ttl:        300,
+			Data:       net.ParseIP("93.184.216.34").To4(),
+		},
+	}
+
+	if _, err := buildResponse(DNSHeader{}, nil, answers, nil, nil); err == nil {
+		t.Fatal("expected an error for an overlong label, got nil")
+	}
+}
+
+// TestBuildResponseRejectsOverlongTXTSegment checks that a TXT segment
+// over 255 bytes fails to encode instead of silently truncating its
+// length prefix.
+func TestBuildResponseRejectsOverlongTXTSegment(t *testing.T) {
+	answers := []DNSRecord{
+		{
+			Name:       []byte("example.com"),
+			RecordType: TypeTXT,
+			Class:      classIN,
+			Ttl:        300,
+			Data:       []string{strings.Repeat("a", maxTXTSegmentLength+1)},
+		},
+	}
+
+	if _, err := buildResponse(DNSHeader{}, nil, answers, nil, nil); err == nil {
+		t.Fatal("expected an error for an overlong TXT segment, got nil")
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+)
+
+const (
+	flagQR = uint16(1 << 15)
+	flagAA = uint16(1 << 10)
+	flagRD = uint16(1 << 8)
+
+	rcodeNXDomain = uint16(3)
+)
+
+// Server is a minimal authoritative DNS server: it listens on UDP and
+// TCP, parses incoming queries with NewParser, answers them out of a
+// Zone, and writes replies with buildResponse.
+type Server struct {
+	zone *Zone
+}
+
+func NewServer(zone *Zone) *Server {
+	return &Server{zone: zone}
+}
+
+// ListenAndServe serves both UDP and TCP on addr until one of them
+// fails.
+func (s *Server) ListenAndServe(addr string) error {
+	errs := make(chan error, 2)
+
+	go func() { errs <- s.serveUDP(addr) }()
+	go func() { errs <- s.serveTCP(addr) }()
+
+	return <-errs
+}
+
+func (s *Server) serveUDP(addr string) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	buffer := make([]byte, udpReadBufferSize)
+	for {
+		n, clientAddr, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			continue
+		}
+
+		query := make([]byte, n)
+		copy(query, buffer[:n])
+
+		response, err := s.handleQuery(query)
+		if err != nil {
+			continue
+		}
+
+		conn.WriteToUDP(response, clientAddr)
+	}
+}
+
+func (s *Server) serveTCP(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			continue
+		}
+
+		go s.serveTCPConn(conn)
+	}
+}
+
+func (s *Server) serveTCPConn(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		lengthBuf := make([]byte, 2)
+		if _, err := io.ReadFull(conn, lengthBuf); err != nil {
+			return
+		}
+		length := binary.BigEndian.Uint16(lengthBuf)
+
+		query := make([]byte, length)
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+
+		response, err := s.handleQuery(query)
+		if err != nil {
+			return
+		}
+
+		lengthPrefix := make([]byte, 2)
+		binary.BigEndian.PutUint16(lengthPrefix, uint16(len(response)))
+		if _, err := conn.Write(append(lengthPrefix, response...)); err != nil {
+			return
+		}
+	}
+}
+
+// handleQuery parses a single query message and builds the matching
+// reply out of s.zone.
+func (s *Server) handleQuery(query []byte) ([]byte, error) {
+	msg, err := NewParser(query).parseMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(msg.Questions) == 0 {
+		return nil, errParsingQuestion
+	}
+
+	question := msg.Questions[0]
+	name := string(question.domainName)
+
+	answers, _ := s.zone.Lookup(name, question.recordType)
+
+	flags := flagQR | flagAA | (msg.Header.Flags & flagRD)
+	if len(answers) == 0 && !s.zone.HasName(name) {
+		flags |= rcodeNXDomain
+	}
+
+	header := DNSHeader{
+		QueryID: msg.Header.QueryID,
+		Flags:   flags,
+	}
+
+	return buildResponse(header, []DNSQuestion{*question}, answers, nil, nil)
+}
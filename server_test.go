@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func newTestServer() *Server {
+	zone := NewZone()
+	zone.Add("example.com", TypeA, DNSRecord{
+		Name:       []byte("example.com"),
+		RecordType: TypeA,
+		Class:      classIN,
+		Ttl:        300,
+		Data:       net.ParseIP("93.184.216.34").To4(),
+	})
+	zone.Add("example.com", TypeMX, DNSRecord{
+		Name:       []byte("example.com"),
+		RecordType: TypeMX,
+		Class:      classIN,
+		Ttl:        300,
+		Data:       MXData{Preference: 10, Exchange: "mail.example.com"},
+	})
+
+	return NewServer(zone)
+}
+
+func handleTestQuery(t *testing.T, s *Server, name string, qtype uint16) *DNSMessage {
+	t.Helper()
+
+	query := buildQueryWithFlags(name, qtype, flagRD)
+
+	response, err := s.handleQuery(query)
+	if err != nil {
+		t.Fatal("handleQuery failed:", err)
+	}
+
+	msg, err := NewParser(response).parseMessage()
+	if err != nil {
+		t.Fatal("failed to parse response:", err)
+	}
+
+	return msg
+}
+
+// TestHandleQueryAnswer checks that a question the zone holds a record
+// for comes back as a plain NOERROR answer.
+func TestHandleQueryAnswer(t *testing.T) {
+	msg := handleTestQuery(t, newTestServer(), "example.com", TypeA)
+
+	if msg.Header.Flags&rcodeNXDomain != 0 {
+		t.Fatal("expected NOERROR, got NXDOMAIN")
+	}
+
+	if len(msg.Answers) != 1 {
+		t.Fatalf("expected 1 answer, got %d", len(msg.Answers))
+	}
+
+	if got := msg.Answers[0].Data.(net.IP).String(); got != "93.184.216.34" {
+		t.Fatalf("unexpected answer data: %q", got)
+	}
+}
+
+// TestHandleQueryNoData checks that a name the zone knows about, but
+// with no record of the queried type, comes back NOERROR with an empty
+// answer section rather than NXDOMAIN.
+func TestHandleQueryNoData(t *testing.T) {
+	msg := handleTestQuery(t, newTestServer(), "example.com", TypeAAAA)
+
+	if msg.Header.Flags&rcodeNXDomain != 0 {
+		t.Fatal("expected NOERROR/NODATA, got NXDOMAIN")
+	}
+
+	if len(msg.Answers) != 0 {
+		t.Fatalf("expected no answers, got %d", len(msg.Answers))
+	}
+}
+
+// TestHandleQueryNXDomain checks that a name the zone has no record
+// for at all comes back with the NXDOMAIN bit set.
+func TestHandleQueryNXDomain(t *testing.T) {
+	msg := handleTestQuery(t, newTestServer(), "nowhere.example.com", TypeA)
+
+	if msg.Header.Flags&rcodeNXDomain == 0 {
+		t.Fatal("expected NXDOMAIN to be set")
+	}
+
+	if len(msg.Answers) != 0 {
+		t.Fatalf("expected no answers, got %d", len(msg.Answers))
+	}
+}
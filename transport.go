@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+)
+
+const (
+	// flagTruncated is the TC bit in the header flags, set by a server
+	// when a UDP response didn't fit and was cut short.
+	flagTruncated = uint16(1 << 9)
+
+	// udpReadBufferSize is sized to comfortably hold EDNS-sized UDP
+	// responses rather than just the original 512-byte minimum.
+	udpReadBufferSize = 4096
+)
+
+// Transport sends a raw DNS message to a server and returns the raw
+// response, over whatever medium it implements (UDP, TCP, TLS, HTTPS).
+// Resolver is written against this interface, so the same query
+// building and message parsing works unchanged no matter which
+// transport it's handed.
+type Transport interface {
+	Exchange(query []byte) ([]byte, error)
+}
+
+// UDPTransport exchanges queries over plain UDP against a single
+// server, falling back to TCP itself when a response comes back
+// truncated (RFC 1035 section 4.2.2).
+type UDPTransport struct {
+	addr     string
+	fallback *TCPTransport
+}
+
+func NewUDPTransport(server string) *UDPTransport {
+	return &UDPTransport{
+		addr:     net.JoinHostPort(server, dnsPort),
+		fallback: NewTCPTransport(server),
+	}
+}
+
+func (t *UDPTransport) Exchange(query []byte) ([]byte, error) {
+	response, err := t.exchangeUDP(query)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := NewParser(response).parseHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	if header.Flags&flagTruncated == 0 {
+		return response, nil
+	}
+
+	return t.fallback.Exchange(query)
+}
+
+func (t *UDPTransport) exchangeUDP(query []byte) ([]byte, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", t.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialUDP("udp", nil, udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+
+	buffer := make([]byte, udpReadBufferSize)
+	n, _, err := conn.ReadFromUDP(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer[:n], nil
+}
+
+// TCPTransport exchanges queries over TCP, length-prefixed per RFC
+// 1035 section 4.2.2, reusing connections out of a small pool rather
+// than dialing fresh for every query.
+type TCPTransport struct {
+	pool *connPool
+}
+
+func NewTCPTransport(server string) *TCPTransport {
+	addr := net.JoinHostPort(server, dnsPort)
+	return &TCPTransport{
+		pool: newConnPool(func() (net.Conn, error) {
+			return net.Dial("tcp", addr)
+		}),
+	}
+}
+
+func (t *TCPTransport) Exchange(query []byte) ([]byte, error) {
+	conn, err := t.pool.get()
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := exchangeFramed(conn, query)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	t.pool.put(conn)
+	return response, nil
+}
+
+// exchangeFramed writes query prefixed with its 2-byte length and reads
+// back a response framed the same way. Shared by TCPTransport and
+// DoTTransport, which only differ in how the underlying conn is dialed.
+func exchangeFramed(conn net.Conn, query []byte) ([]byte, error) {
+	lengthPrefix := make([]byte, 2)
+	binary.BigEndian.PutUint16(lengthPrefix, uint16(len(query)))
+
+	if _, err := conn.Write(append(lengthPrefix, query...)); err != nil {
+		return nil, err
+	}
+
+	respLenBuf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, respLenBuf); err != nil {
+		return nil, err
+	}
+	respLen := binary.BigEndian.Uint16(respLenBuf)
+
+	response := make([]byte, respLen)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// connPool is a small pool of reusable connections for TCP-based
+// transports. It's deliberately simple: a LIFO stack of idle
+// connections behind a mutex, with no health checking - a dead
+// connection just fails the next exchange and is dropped instead of
+// returned to the pool.
+type connPool struct {
+	dial func() (net.Conn, error)
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func newConnPool(dial func() (net.Conn, error)) *connPool {
+	return &connPool{dial: dial}
+}
+
+func (p *connPool) get() (net.Conn, error) {
+	p.mu.Lock()
+	if n := len(p.conns); n > 0 {
+		conn := p.conns[n-1]
+		p.conns = p.conns[:n-1]
+		p.mu.Unlock()
+		return conn, nil
+	}
+	p.mu.Unlock()
+
+	return p.dial()
+}
+
+func (p *connPool) put(conn net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.conns = append(p.conns, conn)
+}
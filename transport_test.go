@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+// TestConnPoolReusesConnections checks that a connection returned with
+// put is the same one handed back by the next get, rather than
+// connPool dialing a fresh connection it didn't need to.
+func TestConnPoolReusesConnections(t *testing.T) {
+	dialCount := 0
+	pool := newConnPool(func() (net.Conn, error) {
+		dialCount++
+		client, server := net.Pipe()
+		go server.Close()
+		return client, nil
+	})
+
+	first, err := pool.get()
+	if err != nil {
+		t.Fatal("get failed:", err)
+	}
+	pool.put(first)
+
+	second, err := pool.get()
+	if err != nil {
+		t.Fatal("get failed:", err)
+	}
+
+	if second != first {
+		t.Fatal("expected get to return the connection just put back")
+	}
+
+	if dialCount != 1 {
+		t.Fatalf("expected exactly 1 dial, got %d", dialCount)
+	}
+}
+
+// TestConnPoolLIFO checks that connections come back out in
+// last-in-first-out order.
+func TestConnPoolLIFO(t *testing.T) {
+	pool := newConnPool(func() (net.Conn, error) {
+		client, server := net.Pipe()
+		go server.Close()
+		return client, nil
+	})
+
+	a, _ := pool.get()
+	b, _ := pool.get()
+
+	pool.put(a)
+	pool.put(b)
+
+	if got, _ := pool.get(); got != b {
+		t.Fatal("expected the most recently put connection to come out first")
+	}
+	if got, _ := pool.get(); got != a {
+		t.Fatal("expected the next get to return the other pooled connection")
+	}
+}
+
+// TestUDPTransportFallsBackToTCPOnTruncation checks that a UDP response
+// with the TC bit set makes Exchange retry the query over TCP instead
+// of returning the truncated answer.
+func TestUDPTransportFallsBackToTCPOnTruncation(t *testing.T) {
+	finalResponse := aAnswer(t, "example.com", "93.184.216.34")
+
+	truncatedResponse := make([]byte, len(finalResponse))
+	copy(truncatedResponse, finalResponse)
+	binary.BigEndian.PutUint16(truncatedResponse[2:4], binary.BigEndian.Uint16(truncatedResponse[2:4])|flagTruncated)
+
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal("failed to start fake UDP server:", err)
+	}
+	defer udpConn.Close()
+
+	var udpQueries atomic.Int32
+	go func() {
+		buf := make([]byte, udpReadBufferSize)
+		for {
+			_, clientAddr, err := udpConn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			udpQueries.Add(1)
+			udpConn.WriteToUDP(truncatedResponse, clientAddr)
+		}
+	}()
+
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("failed to start fake TCP server:", err)
+	}
+	defer tcpListener.Close()
+
+	go func() {
+		conn, err := tcpListener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		lengthBuf := make([]byte, 2)
+		if _, err := io.ReadFull(conn, lengthBuf); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(lengthBuf))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+
+		lengthPrefix := make([]byte, 2)
+		binary.BigEndian.PutUint16(lengthPrefix, uint16(len(finalResponse)))
+		conn.Write(append(lengthPrefix, finalResponse...))
+	}()
+
+	transport := &UDPTransport{
+		addr: udpConn.LocalAddr().String(),
+		fallback: &TCPTransport{
+			pool: newConnPool(func() (net.Conn, error) {
+				return net.Dial("tcp", tcpListener.Addr().String())
+			}),
+		},
+	}
+
+	response, err := transport.Exchange(buildQuery("example.com", TypeA))
+	if err != nil {
+		t.Fatal("Exchange failed:", err)
+	}
+
+	if string(response) != string(finalResponse) {
+		t.Fatal("expected the TCP fallback's response, got the truncated UDP one")
+	}
+
+	if got := udpQueries.Load(); got != 1 {
+		t.Fatalf("expected exactly 1 UDP query, got %d", got)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type zoneKey struct {
+	name       string
+	recordType uint16
+}
+
+// Zone is a simple in-memory authoritative zone: a map from name+type to
+// the records a Server should answer with for that question.
+type Zone struct {
+	records map[zoneKey][]DNSRecord
+	names   map[string]bool
+}
+
+func NewZone() *Zone {
+	return &Zone{
+		records: make(map[zoneKey][]DNSRecord),
+		names:   make(map[string]bool),
+	}
+}
+
+func (z *Zone) Add(name string, recordType uint16, record DNSRecord) {
+	key := zoneKey{name: name, recordType: recordType}
+	z.records[key] = append(z.records[key], record)
+	z.names[name] = true
+}
+
+// Lookup returns the records held for name+recordType, if any.
+func (z *Zone) Lookup(name string, recordType uint16) ([]DNSRecord, bool) {
+	records, ok := z.records[zoneKey{name: name, recordType: recordType}]
+	return records, ok
+}
+
+// HasName reports whether the zone holds any record at all for name,
+// regardless of type - used to tell an empty answer apart from
+// NXDOMAIN.
+func (z *Zone) HasName(name string) bool {
+	return z.names[name]
+}
+
+// LoadZoneFile reads a simplified zone file, one record per line:
+//
+//	name  ttl  class  type  rdata...
+//
+// e.g. "www.example.com. 300 IN A 93.184.216.34". Blank lines and lines
+// starting with ';' are ignored. This isn't a full RFC 1035 master file
+// parser (no $ORIGIN/$TTL directives, no multi-line records) - just
+// enough to seed a Zone for toydns's own server mode.
+func LoadZoneFile(path string) (*Zone, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	zone := NewZone()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if err := addZoneLine(zone, line); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return zone, nil
+}
+
+func addZoneLine(zone *Zone, line string) error {
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
+		return fmt.Errorf("zone file: malformed line %q", line)
+	}
+
+	name := strings.TrimSuffix(fields[0], ".")
+
+	ttl, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return fmt.Errorf("zone file: invalid TTL %q: %w", fields[1], err)
+	}
+
+	// fields[2] is the class (IN); toydns only ever serves IN.
+	recordType, ok := recordTypeByName(fields[3])
+	if !ok {
+		return fmt.Errorf("zone file: unsupported record type %q", fields[3])
+	}
+
+	data, err := parseZoneRecordData(recordType, fields[4:])
+	if err != nil {
+		return err
+	}
+
+	zone.Add(name, recordType, DNSRecord{
+		Name:       []byte(name),
+		RecordType: recordType,
+		Class:      classIN,
+		Ttl:        uint32(ttl),
+		Data:       data,
+	})
+
+	return nil
+}
+
+func recordTypeByName(name string) (uint16, bool) {
+	switch strings.ToUpper(name) {
+	case "A":
+		return TypeA, true
+	case "AAAA":
+		return TypeAAAA, true
+	case "NS":
+		return TypeNS, true
+	case "CNAME":
+		return TypeCNAME, true
+	case "MX":
+		return TypeMX, true
+	case "TXT":
+		return TypeTXT, true
+	case "SOA":
+		return TypeSOA, true
+	case "PTR":
+		return TypePTR, true
+	default:
+		return 0, false
+	}
+}
+
+func parseZoneRecordData(recordType uint16, fields []string) (interface{}, error) {
+	switch recordType {
+	case TypeA, TypeAAAA:
+		if len(fields) != 1 {
+			return nil, fmt.Errorf("zone file: expected a single address, got %v", fields)
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			return nil, fmt.Errorf("zone file: invalid IP address %q", fields[0])
+		}
+		return ip, nil
+
+	case TypeNS, TypeCNAME, TypePTR:
+		if len(fields) != 1 {
+			return nil, fmt.Errorf("zone file: expected a single name, got %v", fields)
+		}
+		return strings.TrimSuffix(fields[0], "."), nil
+
+	case TypeMX:
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("zone file: expected preference and exchange, got %v", fields)
+		}
+		preference, err := strconv.ParseUint(fields[0], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("zone file: invalid MX preference %q: %w", fields[0], err)
+		}
+		return MXData{Preference: uint16(preference), Exchange: strings.TrimSuffix(fields[1], ".")}, nil
+
+	case TypeTXT:
+		return []string{strings.Trim(strings.Join(fields, " "), "\"")}, nil
+
+	case TypeSOA:
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("zone file: expected 7 SOA fields, got %v", fields)
+		}
+		var numbers [5]uint64
+		for i, field := range fields[2:] {
+			n, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("zone file: invalid SOA field %q: %w", field, err)
+			}
+			numbers[i] = n
+		}
+		return SOAData{
+			MName:   strings.TrimSuffix(fields[0], "."),
+			RName:   strings.TrimSuffix(fields[1], "."),
+			Serial:  uint32(numbers[0]),
+			Refresh: uint32(numbers[1]),
+			Retry:   uint32(numbers[2]),
+			Expire:  uint32(numbers[3]),
+			Minimum: uint32(numbers[4]),
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("zone file: unsupported record type %d", recordType)
+	}
+}